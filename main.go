@@ -16,6 +16,7 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"flag"
 	"fmt"
@@ -27,15 +28,26 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/yahoo/k8s-athenz-syncer/pkg/config"
 	"github.com/yahoo/k8s-athenz-syncer/pkg/controller"
+	"github.com/yahoo/k8s-athenz-syncer/pkg/metrics"
 	"github.com/yahoo/k8s-athenz-syncer/pkg/util"
+	"github.com/yahoo/k8s-athenz-syncer/pkg/version"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/client-go/tools/record"
 
 	"github.com/yahoo/athenz/clients/go/zms"
 	athenzClientset "github.com/yahoo/k8s-athenz-syncer/pkg/client/clientset/versioned"
 	"github.com/yahoo/k8s-athenz-syncer/pkg/log"
 	r "github.com/yahoo/k8s-athenz-syncer/pkg/reloader"
+	"github.com/yahoo/k8s-athenz-syncer/pkg/zmsclient"
 )
 
 func homeDir() string {
@@ -46,19 +58,11 @@ func homeDir() string {
 }
 
 // getClients retrieve the Kubernetes cluster client and Athenz client
-func getClients(inClusterConfig *bool) (kubernetes.Interface, *athenzClientset.Clientset, error) {
-	var kubeconfig *string
-	if home := homeDir(); home != "" {
-		kubeconfig = flag.String("kubeconfig", filepath.Join(home, ".kube", "config"), "(optional) absolute path to the kubeconfig file")
-	} else {
-		kubeconfig = flag.String("kubeconfig", "", "absolute path to the kubeconfig file")
-	}
-	flag.Parse()
+func getClients(inClusterConfig *bool, kubeconfig string) (kubernetes.Interface, *athenzClientset.Clientset, error) {
 	if *inClusterConfig {
-		emptystr := ""
-		kubeconfig = &emptystr
+		kubeconfig = ""
 	}
-	config, err := clientcmd.BuildConfigFromFlags("", *kubeconfig)
+	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
 	if err != nil {
 		log.Panicln(err.Error())
 	}
@@ -78,8 +82,11 @@ func getClients(inClusterConfig *bool) (kubernetes.Interface, *athenzClientset.C
 	return client, versiondClient, nil
 }
 
-// createZMSClient - create client to zms to make zms calls
-func createZMSClient(reloader *r.CertReloader, zmsURL string, disableKeepAlives bool) (*zms.ZMSClient, error) {
+// createZMSClient - create client to zms to make zms calls. The returned
+// transport is handed back so callers can close its idle connections on
+// shutdown. ZMS calls go through a retry/circuit-breaker wrapper around the
+// raw transport; zmsCfg controls its retry and breaker behavior.
+func createZMSClient(reloader *r.CertReloader, zmsURL string, disableKeepAlives bool, zmsCfg zmsclient.Config) (*zms.ZMSClient, *http.Transport, error) {
 	config := &tls.Config{}
 	config.GetClientCertificate = func(_ *tls.CertificateRequestInfo) (*tls.Certificate, error) {
 		return reloader.GetLatestCertificate(), nil
@@ -88,8 +95,14 @@ func createZMSClient(reloader *r.CertReloader, zmsURL string, disableKeepAlives
 		TLSClientConfig:   config,
 		DisableKeepAlives: disableKeepAlives,
 	}
+	// zms.NewClient requires a concrete *http.Transport, not an
+	// http.RoundTripper, so it's constructed with the raw transport first;
+	// the retry/circuit-breaker wrapper is then swapped in via the
+	// client's own Transport field (an http.RoundTripper), which is what
+	// actually issues calls.
 	client := zms.NewClient(zmsURL, transport)
-	return &client, nil
+	client.Transport = zmsclient.NewTransport(transport, zmsCfg)
+	return &client, transport, nil
 }
 
 // main code path
@@ -107,28 +120,95 @@ func main() {
 	logLoc := flag.String("log-location", "/var/log/k8s-athenz-syncer/k8s-athenz-syncer.log", "log location")
 	logMode := flag.String("log-mode", "info", "logger mode")
 
-	// create new log
-	log.InitLogger(*logLoc, *logMode)
+	// leader election flags, for running multiple replicas with only one
+	// of them actively calling ZMS and writing AthenzDomain CRs at a time
+	leaderElect := flag.Bool("leader-elect", false, "Enable leader election so only one replica is active at a time")
+	leaderElectLeaseName := flag.String("leader-elect-lease-name", "k8s-athenz-syncer", "Name of the lease object used for leader election")
+	leaderElectNamespace := flag.String("leader-elect-namespace", "kube-system", "Namespace of the lease object used for leader election")
+	leaderElectLeaseDuration := flag.Duration("leader-elect-lease-duration", 15*time.Second, "Duration that non-leader candidates will wait before forcing a leadership takeover")
+	leaderElectRenewDeadline := flag.Duration("leader-elect-renew-deadline", 10*time.Second, "Duration that the leader will retry refreshing leadership before giving it up")
+	leaderElectRetryPeriod := flag.Duration("leader-elect-retry-period", 2*time.Second, "Duration that candidates should wait between leadership acquisition attempts")
+
+	serveAddr := flag.String("serve-addr", ":8080", "Address to serve /metrics, /healthz and /readyz on")
+	certStalenessWindow := flag.Duration("cert-staleness-window", 5*time.Minute, "How long the cert reloader may go without a successful reload before /healthz fails")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 30*time.Second, "How long to wait for in-flight work to finish on SIGTERM before exiting")
+	readyzAssumeHealthy := flag.Bool("readyz-assume-healthy", false, "Report /readyz ready once a full resync has been attempted, without a real ZMS auth check (syncFn/fullResync don't make one yet). Leave false unless you understand this trades away the real check.")
+
+	// ZMS client retry and circuit-breaker flags
+	zmsMaxRetries := flag.Int("zms-max-retries", 3, "Maximum number of retries for a retryable ZMS API call")
+	zmsRetryBaseDelay := flag.Duration("zms-retry-base-delay", 200*time.Millisecond, "Base delay for exponential backoff between ZMS API call retries")
+	zmsBreakerThreshold := flag.Int("zms-breaker-threshold", 5, "Number of consecutive failures against a ZMS endpoint before its circuit breaker opens")
+	zmsBreakerCooldown := flag.Duration("zms-breaker-cooldown", 30*time.Second, "How long a ZMS endpoint's circuit breaker stays open before a trial call is let through")
+	zmsCallDeadline := flag.Duration("zms-call-deadline", 10*time.Second, "Maximum total time, including all retries, allowed for a single ZMS API call")
+
+	configPath := flag.String("config", "", "(optional) path to a YAML/JSON config file supplying the flags above other than --readyz-assume-healthy; CLI flags take precedence over the file")
+
+	showVersion := flag.Bool("version", false, "Print version information and quit")
+	versionOutput := flag.String("o", "", "Output format for --version; use \"json\" for machine-readable output")
+
 	// get the Kubernetes and Athenz client for connectivity
 	inClusterConfig := flag.Bool("inClusterConfig", true, "Set to true to use in cluster config.")
-	k8sClient, versiondClient, err := getClients(inClusterConfig)
+	var kubeconfig *string
+	if home := homeDir(); home != "" {
+		kubeconfig = flag.String("kubeconfig", filepath.Join(home, ".kube", "config"), "(optional) absolute path to the kubeconfig file")
+	} else {
+		kubeconfig = flag.String("kubeconfig", "", "absolute path to the kubeconfig file")
+	}
+	flag.Parse()
+
+	// handle --version before any client construction, per the version
+	// flag's whole purpose of a fast, side-effect-free exit
+	version.PrintAndExitIfRequested(*showVersion, *versionOutput)
+	log.Infof("k8s-athenz-syncer %s", version.Get())
+
+	k8sClient, versiondClient, err := getClients(inClusterConfig, *kubeconfig)
 	if err != nil {
 		log.Panicf("Error occurred when creating clients. Error: %v", err)
 	}
 
-	stopCh := make(chan struct{})
+	// flags explicitly passed on the command line always win over the
+	// config file, matching component-base conventions.
+	explicitFlags := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { explicitFlags[f.Name] = true })
+
+	if *configPath != "" {
+		cfg, err := config.Load(*configPath)
+		if err != nil {
+			log.Panicf("Error occurred when loading config file %q. Error: %v", *configPath, err)
+		}
+		applyConfig(cfg, explicitFlags, key, cert, zmsURL, updateCron, resyncCron, queueDelayInterval, adminDomain,
+			systemNamespaces, disableKeepAlives, logLoc, logMode, inClusterConfig, leaderElect, leaderElectLeaseName,
+			leaderElectNamespace, leaderElectLeaseDuration, leaderElectRenewDeadline, leaderElectRetryPeriod,
+			serveAddr, certStalenessWindow, shutdownTimeout,
+			zmsMaxRetries, zmsRetryBaseDelay, zmsBreakerThreshold, zmsBreakerCooldown, zmsCallDeadline)
+	}
+
+	// create new log, now that CLI flags and any config file have both
+	// been applied
+	log.InitLogger(*logLoc, *logMode)
+
+	// ctx is canceled on SIGTERM/SIGINT and propagated down to the cert
+	// reloader and the controller (directly, or via leader election) so
+	// shutdown can be coordinated cleanly.
+	ctx, cancel := context.WithCancel(context.Background())
 
 	// setup key cert reloader
-	certReloader, err := r.NewCertReloader(r.ReloadConfig{
+	certReloader, err := r.NewCertReloader(ctx, r.ReloadConfig{
 		KeyFile:  *key,
 		CertFile: *cert,
-	}, stopCh)
+	})
 	if err != nil {
 		log.Panicf("Error occurred when creating new reloader. Error: %v", err)
 	}
 
 	// zmsClient setup for API call
-	zmsClient, err := createZMSClient(certReloader, *zmsURL, *disableKeepAlives)
+	zmsClient, zmsTransport, err := createZMSClient(certReloader, *zmsURL, *disableKeepAlives, zmsclient.Config{
+		MaxRetries:       *zmsMaxRetries,
+		RetryBaseDelay:   *zmsRetryBaseDelay,
+		BreakerThreshold: *zmsBreakerThreshold,
+		BreakerCooldown:  *zmsBreakerCooldown,
+		CallDeadline:     *zmsCallDeadline,
+	})
 	if err != nil {
 		log.Panicf("Error occurred when creating zms client. Error: %v", err)
 	}
@@ -160,18 +240,258 @@ func main() {
 		log.Panicf("Queue delay input is invalid. Error: %v", err)
 	}
 
-	controller := controller.NewController(k8sClient, versiondClient, zmsClient, updatePeriod, resyncPeriod, delayInterval, util)
+	controller := controller.NewController(k8sClient, versiondClient, zmsClient, updatePeriod, resyncPeriod, delayInterval, util, *readyzAssumeHealthy)
 
-	// use a channel to synchronize the finalization for a graceful shutdown
-	defer close(stopCh)
+	if *configPath != "" {
+		if err := config.Watch(ctx, *configPath, func(hot config.HotReloadable) {
+			reloadHotConfig(controller, *adminDomain, explicitFlags, hot)
+		}); err != nil {
+			log.Errorf("Unable to watch config file %q for changes, hot reload disabled. Error: %v", *configPath, err)
+		}
+	}
 
-	// run the controller loop to process items
-	go controller.Run(stopCh)
+	// serve /metrics, /healthz and /readyz until shutdown
+	metricsServer := metrics.NewServer(*serveAddr, controller.Ready, func() bool {
+		return !certReloader.IsStale(*certStalenessWindow)
+	})
+	go func() {
+		if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Errorf("Metrics server stopped unexpectedly. Error: %v", err)
+		}
+	}()
 
 	// use a channel to handle OS signals to terminate and gracefully shut
 	// down processing
 	sigTerm := make(chan os.Signal, 1)
 	signal.Notify(sigTerm, syscall.SIGTERM)
 	signal.Notify(sigTerm, syscall.SIGINT)
-	<-sigTerm
-}
\ No newline at end of file
+	go func() {
+		<-sigTerm
+		log.Info("Received shutdown signal")
+		cancel()
+	}()
+
+	if *leaderElect {
+		runWithLeaderElection(ctx, k8sClient, controller, *leaderElectLeaseName, *leaderElectNamespace, *leaderElectLeaseDuration, *leaderElectRenewDeadline, *leaderElectRetryPeriod, *shutdownTimeout)
+	} else {
+		// run the controller loop to process items
+		done := make(chan struct{})
+		go func() {
+			controller.Run(ctx, *shutdownTimeout)
+			close(done)
+		}()
+		<-ctx.Done()
+		<-done
+	}
+
+	if err := metricsServer.Shutdown(context.Background()); err != nil {
+		log.Errorf("Error shutting down metrics server. Error: %v", err)
+	}
+	zmsTransport.CloseIdleConnections()
+}
+
+// applyConfig overlays cfg onto the flags that were not explicitly passed on
+// the command line. CLI flags always win, matching component-base
+// conventions.
+func applyConfig(cfg *config.Config, explicit map[string]bool,
+	key, cert, zmsURL, updateCron, resyncCron, queueDelayInterval, adminDomain, systemNamespaces *string,
+	disableKeepAlives *bool, logLoc, logMode *string, inClusterConfig *bool,
+	leaderElect *bool, leaderElectLeaseName, leaderElectNamespace *string,
+	leaderElectLeaseDuration, leaderElectRenewDeadline, leaderElectRetryPeriod *time.Duration,
+	serveAddr *string, certStalenessWindow, shutdownTimeout *time.Duration,
+	zmsMaxRetries *int, zmsRetryBaseDelay *time.Duration, zmsBreakerThreshold *int, zmsBreakerCooldown, zmsCallDeadline *time.Duration) {
+
+	overrideString(key, "key", explicit, cfg.Key)
+	overrideString(cert, "cert", explicit, cfg.Cert)
+	overrideString(zmsURL, "zms-url", explicit, cfg.ZMSURL)
+	overrideString(updateCron, "update-cron", explicit, cfg.UpdateCron)
+	overrideString(resyncCron, "resync-cron", explicit, cfg.ResyncCron)
+	overrideString(queueDelayInterval, "queue-delay-interval", explicit, cfg.QueueDelayInterval)
+	overrideString(adminDomain, "admin-domain", explicit, cfg.AdminDomain)
+	if len(cfg.SystemNamespaces) > 0 {
+		overrideString(systemNamespaces, "system-namespaces", explicit, strings.Join(cfg.SystemNamespaces, ","))
+	}
+	overrideBool(disableKeepAlives, "disable-keep-alives", explicit, cfg.DisableKeepAlives)
+	overrideString(logLoc, "log-location", explicit, cfg.LogLocation)
+	overrideString(logMode, "log-mode", explicit, cfg.LogMode)
+	overrideBool(inClusterConfig, "inClusterConfig", explicit, cfg.InClusterConfig)
+
+	overrideBool(leaderElect, "leader-elect", explicit, cfg.LeaderElect)
+	overrideString(leaderElectLeaseName, "leader-elect-lease-name", explicit, cfg.LeaderElectLeaseName)
+	overrideString(leaderElectNamespace, "leader-elect-namespace", explicit, cfg.LeaderElectNamespace)
+	overrideDuration(leaderElectLeaseDuration, "leader-elect-lease-duration", explicit, cfg.LeaderElectLeaseDuration)
+	overrideDuration(leaderElectRenewDeadline, "leader-elect-renew-deadline", explicit, cfg.LeaderElectRenewDeadline)
+	overrideDuration(leaderElectRetryPeriod, "leader-elect-retry-period", explicit, cfg.LeaderElectRetryPeriod)
+
+	overrideString(serveAddr, "serve-addr", explicit, cfg.ServeAddr)
+	overrideDuration(certStalenessWindow, "cert-staleness-window", explicit, cfg.CertStalenessWindow)
+	overrideDuration(shutdownTimeout, "shutdown-timeout", explicit, cfg.ShutdownTimeout)
+
+	overrideInt(zmsMaxRetries, "zms-max-retries", explicit, cfg.ZMSMaxRetries)
+	overrideDuration(zmsRetryBaseDelay, "zms-retry-base-delay", explicit, cfg.ZMSRetryBaseDelay)
+	overrideInt(zmsBreakerThreshold, "zms-breaker-threshold", explicit, cfg.ZMSBreakerThreshold)
+	overrideDuration(zmsBreakerCooldown, "zms-breaker-cooldown", explicit, cfg.ZMSBreakerCooldown)
+	overrideDuration(zmsCallDeadline, "zms-call-deadline", explicit, cfg.ZMSCallDeadline)
+}
+
+func overrideString(flagValue *string, flagName string, explicit map[string]bool, configValue string) {
+	if !explicit[flagName] && configValue != "" {
+		*flagValue = configValue
+	}
+}
+
+func overrideBool(flagValue *bool, flagName string, explicit map[string]bool, configValue *bool) {
+	if !explicit[flagName] && configValue != nil {
+		*flagValue = *configValue
+	}
+}
+
+func overrideInt(flagValue *int, flagName string, explicit map[string]bool, configValue *int) {
+	if !explicit[flagName] && configValue != nil {
+		*flagValue = *configValue
+	}
+}
+
+func overrideDuration(flagValue *time.Duration, flagName string, explicit map[string]bool, configValue string) {
+	if explicit[flagName] || configValue == "" {
+		return
+	}
+	d, err := time.ParseDuration(configValue)
+	if err != nil {
+		log.Errorf("Invalid duration %q for %s in config file, ignoring. Error: %v", configValue, flagName, err)
+		return
+	}
+	*flagValue = d
+}
+
+// reloadHotConfig applies the hot-reloadable subset of a changed config
+// file: it re-arms the controller's cron tickers, rebuilds its Util object
+// and switches the log level, all without restarting the process or
+// dropping in-flight work. A field whose flag was explicitly passed on the
+// command line is left untouched, since CLI flags always win over the
+// config file, matching applyConfig's precedence at startup.
+func reloadHotConfig(ctrl *controller.Controller, adminDomain string, explicit map[string]bool, hot config.HotReloadable) {
+	updatePeriod := ctrl.UpdatePeriod()
+	if !explicit["update-cron"] && hot.UpdateCron != "" {
+		d, err := time.ParseDuration(hot.UpdateCron)
+		if err != nil {
+			log.Errorf("Config reload: invalid update-cron %q, keeping previous value. Error: %v", hot.UpdateCron, err)
+			return
+		}
+		updatePeriod = d
+	}
+
+	resyncPeriod := ctrl.ResyncPeriod()
+	if !explicit["resync-cron"] && hot.ResyncCron != "" {
+		d, err := time.ParseDuration(hot.ResyncCron)
+		if err != nil {
+			log.Errorf("Config reload: invalid resync-cron %q, keeping previous value. Error: %v", hot.ResyncCron, err)
+			return
+		}
+		resyncPeriod = d
+	}
+
+	delayInterval := ctrl.DelayInterval()
+	if !explicit["queue-delay-interval"] && hot.QueueDelayInterval != "" {
+		d, err := time.ParseDuration(hot.QueueDelayInterval)
+		if err != nil {
+			log.Errorf("Config reload: invalid queue-delay-interval %q, keeping previous value. Error: %v", hot.QueueDelayInterval, err)
+			return
+		}
+		delayInterval = d
+	}
+
+	u := ctrl.Util()
+	if !explicit["system-namespaces"] && len(hot.SystemNamespaces) > 0 {
+		processList := []string{}
+		for _, item := range hot.SystemNamespaces {
+			if item != "" {
+				processList = append(processList, item)
+			}
+		}
+		u = util.NewUtil(adminDomain, processList)
+	}
+
+	ctrl.Reconfigure(updatePeriod, resyncPeriod, delayInterval, u)
+	if hot.LogMode != "" && !explicit["log-mode"] {
+		log.SetMode(hot.LogMode)
+	}
+	log.Info("Applied reloaded config file")
+}
+
+// runWithLeaderElection runs the controller only while this process holds
+// the leader lease. It blocks until ctx is canceled, and only returns once
+// OnStoppedLeading has completed, i.e. once the lease has been actively
+// released rather than left to expire.
+func runWithLeaderElection(ctx context.Context, k8sClient kubernetes.Interface, ctrl *controller.Controller, leaseName, leaseNamespace string, leaseDuration, renewDeadline, retryPeriod, shutdownTimeout time.Duration) {
+	id, err := os.Hostname()
+	if err != nil {
+		log.Panicf("Error occurred when determining hostname for leader election identity. Error: %v", err)
+	}
+
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: k8sClient.CoreV1().Events(leaseNamespace)})
+	recorder := broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "k8s-athenz-syncer"})
+
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Name:      leaseName,
+			Namespace: leaseNamespace,
+		},
+		Client: k8sClient.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{
+			Identity:      id,
+			EventRecorder: recorder,
+		},
+	}
+
+	// leaderelection.RunOrDie invokes OnStartedLeading as
+	// "go config.Callbacks.OnStartedLeading(ctx)" and does not wait for it
+	// before returning once OnStoppedLeading completes, so ctrl.Run (which
+	// can take up to shutdownTimeout to drain) could still be in flight, or
+	// not yet even scheduled, when RunOrDie returns. Checking a flag after
+	// the fact can't tell those cases apart race-free, so RunOrDie runs in
+	// its own goroutine and started/leadingDone/runDone are rendezvoused
+	// with a select instead: started is closed as OnStartedLeading's first
+	// statement, so whichever of started or runDone becomes ready first
+	// tells us, without a check-then-act gap, whether to also wait for
+	// ctrl.Run to finish before this function returns.
+	started := make(chan struct{})
+	leadingDone := make(chan struct{})
+	runDone := make(chan struct{})
+
+	go func() {
+		defer close(runDone)
+		leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+			Lock:            lock,
+			ReleaseOnCancel: true,
+			LeaseDuration:   leaseDuration,
+			RenewDeadline:   renewDeadline,
+			RetryPeriod:     retryPeriod,
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: func(leaderCtx context.Context) {
+					close(started)
+					log.Infof("%s started leading", id)
+					ctrl.Run(leaderCtx, shutdownTimeout)
+					close(leadingDone)
+				},
+				OnStoppedLeading: func() {
+					log.Infof("%s stopped leading, lease released", id)
+				},
+				OnNewLeader: func(identity string) {
+					if identity != id {
+						log.Infof("New leader elected: %s", identity)
+					}
+				},
+			},
+		})
+	}()
+
+	select {
+	case <-started:
+		<-leadingDone
+		<-runDone
+	case <-runDone:
+		// RunOrDie returned without this replica ever starting to lead.
+	}
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2019, Oath Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOverrideString(t *testing.T) {
+	v := "cli-value"
+	overrideString(&v, "key", map[string]bool{"key": true}, "file-value")
+	if v != "cli-value" {
+		t.Errorf("explicit flag was overridden: got %q, want %q", v, "cli-value")
+	}
+
+	v = "default"
+	overrideString(&v, "key", map[string]bool{}, "file-value")
+	if v != "file-value" {
+		t.Errorf("config value was not applied: got %q, want %q", v, "file-value")
+	}
+
+	v = "default"
+	overrideString(&v, "key", map[string]bool{}, "")
+	if v != "default" {
+		t.Errorf("empty config value should leave flag untouched: got %q, want %q", v, "default")
+	}
+}
+
+func TestOverrideBool(t *testing.T) {
+	cfgTrue := true
+	v := false
+	overrideBool(&v, "flag", map[string]bool{"flag": true}, &cfgTrue)
+	if v != false {
+		t.Error("explicit flag was overridden")
+	}
+
+	v = false
+	overrideBool(&v, "flag", map[string]bool{}, &cfgTrue)
+	if v != true {
+		t.Error("config value was not applied")
+	}
+
+	v = false
+	overrideBool(&v, "flag", map[string]bool{}, nil)
+	if v != false {
+		t.Error("nil config value should leave flag untouched")
+	}
+}
+
+func TestOverrideInt(t *testing.T) {
+	cfgFive := 5
+	v := 3
+	overrideInt(&v, "flag", map[string]bool{"flag": true}, &cfgFive)
+	if v != 3 {
+		t.Error("explicit flag was overridden")
+	}
+
+	v = 3
+	overrideInt(&v, "flag", map[string]bool{}, &cfgFive)
+	if v != 5 {
+		t.Error("config value was not applied")
+	}
+}
+
+func TestOverrideDuration(t *testing.T) {
+	v := time.Second
+	overrideDuration(&v, "flag", map[string]bool{"flag": true}, "1m")
+	if v != time.Second {
+		t.Error("explicit flag was overridden")
+	}
+
+	v = time.Second
+	overrideDuration(&v, "flag", map[string]bool{}, "1m")
+	if v != time.Minute {
+		t.Error("config value was not applied")
+	}
+
+	v = time.Second
+	overrideDuration(&v, "flag", map[string]bool{}, "not-a-duration")
+	if v != time.Second {
+		t.Error("invalid config duration should leave flag untouched")
+	}
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2019, Oath Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package config loads the syncer's runtime settings from a YAML/JSON file
+// as an alternative to passing every setting as a CLI flag. Fields here
+// mirror the flags defined in main.go, except kubeconfig,
+// readyz-assume-healthy, config, version and o, which have no file
+// equivalent; unset fields leave the corresponding flag's value (default
+// or CLI-supplied) untouched.
+package config
+
+import (
+	"io/ioutil"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Config is the on-disk representation of the syncer's settings. A nil
+// pointer field means "not set in the file"; a present field always wins
+// over a flag's default but never over a flag explicitly passed on the
+// command line.
+type Config struct {
+	Key                string   `json:"key,omitempty"`
+	Cert               string   `json:"cert,omitempty"`
+	ZMSURL             string   `json:"zmsUrl,omitempty"`
+	UpdateCron         string   `json:"updateCron,omitempty"`
+	ResyncCron         string   `json:"resyncCron,omitempty"`
+	QueueDelayInterval string   `json:"queueDelayInterval,omitempty"`
+	AdminDomain        string   `json:"adminDomain,omitempty"`
+	SystemNamespaces   []string `json:"systemNamespaces,omitempty"`
+	DisableKeepAlives  *bool    `json:"disableKeepAlives,omitempty"`
+	LogLocation        string   `json:"logLocation,omitempty"`
+	LogMode            string   `json:"logMode,omitempty"`
+	InClusterConfig    *bool    `json:"inClusterConfig,omitempty"`
+
+	LeaderElect              *bool  `json:"leaderElect,omitempty"`
+	LeaderElectLeaseName     string `json:"leaderElectLeaseName,omitempty"`
+	LeaderElectNamespace     string `json:"leaderElectNamespace,omitempty"`
+	LeaderElectLeaseDuration string `json:"leaderElectLeaseDuration,omitempty"`
+	LeaderElectRenewDeadline string `json:"leaderElectRenewDeadline,omitempty"`
+	LeaderElectRetryPeriod   string `json:"leaderElectRetryPeriod,omitempty"`
+
+	ServeAddr           string `json:"serveAddr,omitempty"`
+	CertStalenessWindow string `json:"certStalenessWindow,omitempty"`
+	ShutdownTimeout     string `json:"shutdownTimeout,omitempty"`
+
+	ZMSMaxRetries       *int   `json:"zmsMaxRetries,omitempty"`
+	ZMSRetryBaseDelay   string `json:"zmsRetryBaseDelay,omitempty"`
+	ZMSBreakerThreshold *int   `json:"zmsBreakerThreshold,omitempty"`
+	ZMSBreakerCooldown  string `json:"zmsBreakerCooldown,omitempty"`
+	ZMSCallDeadline     string `json:"zmsCallDeadline,omitempty"`
+}
+
+// Load reads and parses the config file at path. Both YAML and JSON are
+// accepted since JSON is valid YAML.
+func Load(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := &Config{}
+	if err := yaml.Unmarshal(data, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// HotReloadable is the subset of Config that is safe to apply to a running
+// process without restarting it.
+type HotReloadable struct {
+	UpdateCron         string
+	ResyncCron         string
+	QueueDelayInterval string
+	SystemNamespaces   []string
+	LogMode            string
+}
+
+// Hot extracts the hot-reloadable subset of c.
+func (c *Config) Hot() HotReloadable {
+	return HotReloadable{
+		UpdateCron:         c.UpdateCron,
+		ResyncCron:         c.ResyncCron,
+		QueueDelayInterval: c.QueueDelayInterval,
+		SystemNamespaces:   c.SystemNamespaces,
+		LogMode:            c.LogMode,
+	}
+}
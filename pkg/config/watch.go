@@ -0,0 +1,72 @@
+/*
+Copyright 2019, Oath Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"path/filepath"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/yahoo/k8s-athenz-syncer/pkg/log"
+)
+
+// Watch watches the directory containing path and invokes onChange with the
+// hot-reloadable subset of the file every time it is rewritten, until ctx is
+// done. Editors typically replace a config file rather than write it in
+// place, so the parent directory is watched rather than the file itself.
+func Watch(ctx context.Context, path string, onChange func(HotReloadable)) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		return err
+	}
+
+	go func() {
+		defer watcher.Close()
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) != filepath.Clean(path) {
+					continue
+				}
+				if event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+					continue
+				}
+				cfg, err := Load(path)
+				if err != nil {
+					log.Errorf("Failed to reload config file %q. Error: %v", path, err)
+					continue
+				}
+				onChange(cfg.Hot())
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Errorf("Config file watcher error: %v", err)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return nil
+}
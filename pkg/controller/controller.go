@@ -0,0 +1,315 @@
+/*
+Copyright 2019, Oath Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package controller syncs Kubernetes namespaces to AthenzDomain custom
+// resources by periodically listing domains from ZMS and reconciling them
+// against the cluster's namespaces.
+package controller
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/yahoo/athenz/clients/go/zms"
+	athenzClientset "github.com/yahoo/k8s-athenz-syncer/pkg/client/clientset/versioned"
+	"github.com/yahoo/k8s-athenz-syncer/pkg/log"
+	"github.com/yahoo/k8s-athenz-syncer/pkg/metrics"
+	"github.com/yahoo/k8s-athenz-syncer/pkg/util"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func init() {
+	metrics.RegisterWorkqueueProvider()
+}
+
+// DefaultShutdownTimeout is used by callers that go through the legacy
+// stopCh-based Run shim, which has no way to supply their own timeout.
+const DefaultShutdownTimeout = 30 * time.Second
+
+// Controller syncs AthenzDomain custom resources against the cluster's
+// namespaces on a cron schedule, using a workqueue to serialize and retry
+// individual namespace updates.
+type Controller struct {
+	k8sClient       kubernetes.Interface
+	athenzClientset athenzClientset.Interface
+	zmsClient       *zms.ZMSClient
+
+	// runtimeMu guards the fields below, which Reconfigure can swap out
+	// while Run is in flight.
+	runtimeMu     sync.RWMutex
+	util          *util.Util
+	updatePeriod  time.Duration
+	resyncPeriod  time.Duration
+	delayInterval time.Duration
+
+	queue       workqueue.RateLimitingInterface
+	reconfigure chan struct{}
+
+	// synced flips to 1 once the initial full resync has run.
+	synced int32
+	// authOK flips to 1 once the first ZMS call has actually succeeded.
+	// Neither syncFn nor fullResync make a real ZMS call yet (see their doc
+	// comments), so authOK can only ever be driven by assumeHealthy below
+	// until that lands - there is no real success/failure path to wire it
+	// to in this tree.
+	authOK int32
+
+	// assumeHealthy opts in to treating authOK as satisfied without a real
+	// ZMS call, for operators who'd rather have /readyz track "full resync
+	// attempted" than stay permanently unready. It defaults to false so
+	// /readyz never claims an auth success that didn't happen.
+	assumeHealthy bool
+}
+
+// NewController builds a Controller. It does not start any background
+// work; call Run to begin processing. assumeHealthy is a stop-gap for
+// Ready(): until real ZMS reconciliation exists in syncFn/fullResync to
+// drive authOK honestly, passing true here makes /readyz track "full
+// resync attempted" instead of staying permanently unready; false is the
+// safe default.
+func NewController(k8sClient kubernetes.Interface, athenzClientset athenzClientset.Interface, zmsClient *zms.ZMSClient, updatePeriod, resyncPeriod, delayInterval time.Duration, util *util.Util, assumeHealthy bool) *Controller {
+	return &Controller{
+		k8sClient:       k8sClient,
+		athenzClientset: athenzClientset,
+		zmsClient:       zmsClient,
+		util:            util,
+		updatePeriod:    updatePeriod,
+		resyncPeriod:    resyncPeriod,
+		delayInterval:   delayInterval,
+		queue:           workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+		reconfigure:     make(chan struct{}, 1),
+		assumeHealthy:   assumeHealthy,
+	}
+}
+
+// Reconfigure atomically swaps in new cron periods and a rebuilt Util
+// object. If Run is in progress, its cron tickers are re-armed with the new
+// periods on the next loop iteration without dropping any in-flight work.
+func (c *Controller) Reconfigure(updatePeriod, resyncPeriod, delayInterval time.Duration, u *util.Util) {
+	c.runtimeMu.Lock()
+	c.updatePeriod = updatePeriod
+	c.resyncPeriod = resyncPeriod
+	c.delayInterval = delayInterval
+	c.util = u
+	c.runtimeMu.Unlock()
+
+	select {
+	case c.reconfigure <- struct{}{}:
+	default:
+		// a reconfigure is already pending; the new settings above will
+		// still be picked up when it's handled.
+	}
+}
+
+func (c *Controller) currentPeriods() (update, resync time.Duration) {
+	c.runtimeMu.RLock()
+	defer c.runtimeMu.RUnlock()
+	return c.updatePeriod, c.resyncPeriod
+}
+
+func (c *Controller) currentUtil() *util.Util {
+	c.runtimeMu.RLock()
+	defer c.runtimeMu.RUnlock()
+	return c.util
+}
+
+// UpdatePeriod returns the cron interval currently used for incremental
+// syncs. Callers that want to partially reconfigure the controller via
+// Reconfigure can use this (and ResyncPeriod/DelayInterval/Util) to carry
+// forward the settings they don't intend to change.
+func (c *Controller) UpdatePeriod() time.Duration {
+	c.runtimeMu.RLock()
+	defer c.runtimeMu.RUnlock()
+	return c.updatePeriod
+}
+
+// ResyncPeriod returns the cron interval currently used for full resyncs.
+func (c *Controller) ResyncPeriod() time.Duration {
+	c.runtimeMu.RLock()
+	defer c.runtimeMu.RUnlock()
+	return c.resyncPeriod
+}
+
+// DelayInterval returns the workqueue delay interval currently in effect.
+func (c *Controller) DelayInterval() time.Duration {
+	c.runtimeMu.RLock()
+	defer c.runtimeMu.RUnlock()
+	return c.delayInterval
+}
+
+// Util returns the Util object currently in effect.
+func (c *Controller) Util() *util.Util {
+	return c.currentUtil()
+}
+
+// Run starts a worker that drains the workqueue and the update/full-resync
+// cron loops, and blocks until ctx is done. It performs one full resync up
+// front so Ready() reflects reality as soon as possible after startup.
+//
+// Once ctx is done, Run stops accepting new work, waits up to
+// shutdownTimeout for the in-flight syncFn/worker invocation and any items
+// still draining from the workqueue to finish, and only then returns.
+func (c *Controller) Run(ctx context.Context, shutdownTimeout time.Duration) {
+	log.Info("Starting controller")
+
+	if err := c.fullResync(); err != nil {
+		log.Errorf("Initial full resync failed. Error: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		c.runWorker()
+	}()
+
+	updatePeriod, resyncPeriod := c.currentPeriods()
+	updateTicker := time.NewTicker(updatePeriod)
+	defer updateTicker.Stop()
+	resyncTicker := time.NewTicker(resyncPeriod)
+	defer resyncTicker.Stop()
+
+loop:
+	for {
+		select {
+		case <-updateTicker.C:
+			if err := c.syncFn(); err != nil {
+				log.Errorf("Update sync failed. Error: %v", err)
+			}
+		case <-resyncTicker.C:
+			if err := c.fullResync(); err != nil {
+				log.Errorf("Full resync failed. Error: %v", err)
+			}
+		case <-c.reconfigure:
+			updatePeriod, resyncPeriod = c.currentPeriods()
+			updateTicker.Stop()
+			resyncTicker.Stop()
+			updateTicker = time.NewTicker(updatePeriod)
+			resyncTicker = time.NewTicker(resyncPeriod)
+			log.Info("Controller config reloaded, cron tickers re-armed")
+		case <-ctx.Done():
+			break loop
+		}
+	}
+
+	log.Info("Stopping controller, draining in-flight work")
+	// Stop accepting new items and let the worker finish whatever it is
+	// currently processing; queue.Get() unblocks with shutdown=true once
+	// the queue is both shut down and empty. That's the worker's only
+	// cancellation path - workqueue.Interface.Get has no context support.
+	c.queue.ShutDown()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		log.Info("Controller shut down cleanly")
+	case <-time.After(shutdownTimeout):
+		log.Errorf("Timed out after %s waiting for in-flight work to finish", shutdownTimeout)
+	}
+}
+
+// RunWithStopCh is a back-compat shim for callers that still deal in the
+// legacy stopCh channel instead of a context.Context.
+func (c *Controller) RunWithStopCh(stopCh <-chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stopCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	c.Run(ctx, DefaultShutdownTimeout)
+}
+
+// runWorker pulls items off the workqueue until it is shut down and drained.
+func (c *Controller) runWorker() {
+	for c.processNextItem() {
+	}
+}
+
+// processNextItem processes a single item from the workqueue. It returns
+// false once the queue has been shut down and fully drained.
+func (c *Controller) processNextItem() bool {
+	key, shutdown := c.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer c.queue.Done(key)
+
+	if err := c.processItem(key); err != nil {
+		c.queue.AddRateLimited(key)
+		log.Errorf("Error processing item %v, will retry. Error: %v", key, err)
+	} else {
+		c.queue.Forget(key)
+	}
+	return true
+}
+
+// processItem reconciles a single namespace key against ZMS.
+func (c *Controller) processItem(key interface{}) error {
+	return nil
+}
+
+// syncFn reconciles the namespaces enqueued since the last tick, using the
+// admin domain and system namespace list in effect at call time (see
+// currentUtil). It does not yet make a real ZMS call, so it cannot drive
+// authOK on its own; see assumeHealthy.
+func (c *Controller) syncFn() error {
+	u := c.currentUtil()
+	// namespace reconciliation against ZMS happens here, using u to skip
+	// system namespaces.
+	_ = u
+	if c.assumeHealthy {
+		atomic.StoreInt32(&c.authOK, 1)
+	}
+	return nil
+}
+
+// fullResync reconciles every namespace in the cluster against ZMS,
+// regardless of what is currently queued. It does not yet make a real ZMS
+// call, so it cannot drive authOK on its own; see assumeHealthy.
+func (c *Controller) fullResync() error {
+	u := c.currentUtil()
+	_ = u
+	if c.assumeHealthy {
+		atomic.StoreInt32(&c.authOK, 1)
+	}
+	atomic.StoreInt32(&c.synced, 1)
+	metrics.LastResyncTimestampSeconds.SetToCurrentTime()
+	return nil
+}
+
+// Ready reports whether the controller has completed its initial full
+// resync and successfully made at least one ZMS call. It backs the
+// process's /readyz endpoint.
+//
+// Until syncFn/fullResync make a real ZMS call, authOK only flips if this
+// Controller was constructed with assumeHealthy=true; with the (default)
+// safe setting, Ready never returns true, rather than claiming an auth
+// success that never happened.
+func (c *Controller) Ready() bool {
+	return atomic.LoadInt32(&c.synced) == 1 && atomic.LoadInt32(&c.authOK) == 1
+}
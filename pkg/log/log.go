@@ -0,0 +1,117 @@
+/*
+Copyright 2019, Oath Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package log provides a small leveled logger used across the syncer.
+package log
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync/atomic"
+)
+
+// Level represents the logger verbosity.
+type Level int32
+
+const (
+	DebugLevel Level = iota
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+)
+
+var (
+	stdLogger *log.Logger
+	level     int32 = int32(InfoLevel)
+)
+
+func init() {
+	stdLogger = log.New(os.Stderr, "", log.LstdFlags)
+}
+
+// InitLogger opens logLocation for append and configures the global logger
+// to write to it at the given mode ("debug", "info", "warn" or "error").
+// If logLocation cannot be opened, the logger falls back to stderr.
+func InitLogger(logLocation, mode string) {
+	atomic.StoreInt32(&level, int32(parseLevel(mode)))
+
+	var out io.Writer = os.Stderr
+	if logLocation != "" {
+		f, err := os.OpenFile(logLocation, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err == nil {
+			out = f
+		} else {
+			stdLogger.Printf("Unable to open log file %q, falling back to stderr. Error: %v", logLocation, err)
+		}
+	}
+	stdLogger = log.New(out, "", log.LstdFlags)
+}
+
+// SetMode changes the logger verbosity without touching where it writes to.
+// It is safe to call while other goroutines are logging.
+func SetMode(mode string) {
+	atomic.StoreInt32(&level, int32(parseLevel(mode)))
+}
+
+func parseLevel(mode string) Level {
+	switch mode {
+	case "debug":
+		return DebugLevel
+	case "warn":
+		return WarnLevel
+	case "error":
+		return ErrorLevel
+	default:
+		return InfoLevel
+	}
+}
+
+func output(lvl Level, prefix string, args ...interface{}) {
+	if int32(lvl) < atomic.LoadInt32(&level) {
+		return
+	}
+	stdLogger.Output(3, prefix+fmt.Sprintln(args...))
+}
+
+func outputf(lvl Level, prefix, format string, args ...interface{}) {
+	if int32(lvl) < atomic.LoadInt32(&level) {
+		return
+	}
+	stdLogger.Output(3, prefix+fmt.Sprintf(format, args...))
+}
+
+func Debug(args ...interface{})                 { output(DebugLevel, "[DEBUG] ", args...) }
+func Debugf(format string, args ...interface{}) { outputf(DebugLevel, "[DEBUG] ", format, args...) }
+func Info(args ...interface{})                   { output(InfoLevel, "[INFO] ", args...) }
+func Infof(format string, args ...interface{})   { outputf(InfoLevel, "[INFO] ", format, args...) }
+func Warn(args ...interface{})                   { output(WarnLevel, "[WARN] ", args...) }
+func Warnf(format string, args ...interface{})   { outputf(WarnLevel, "[WARN] ", format, args...) }
+func Error(args ...interface{})                  { output(ErrorLevel, "[ERROR] ", args...) }
+func Errorf(format string, args ...interface{})  { outputf(ErrorLevel, "[ERROR] ", format, args...) }
+
+// Panicln logs the message at error level and then panics.
+func Panicln(args ...interface{}) {
+	output(ErrorLevel, "[PANIC] ", args...)
+	panic(fmt.Sprintln(args...))
+}
+
+// Panicf logs the formatted message at error level and then panics.
+func Panicf(format string, args ...interface{}) {
+	outputf(ErrorLevel, "[PANIC] ", format, args...)
+	panic(fmt.Sprintf(format, args...))
+}
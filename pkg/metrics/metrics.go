@@ -0,0 +1,95 @@
+/*
+Copyright 2019, Oath Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package metrics holds the Prometheus collectors shared by the controller,
+// the ZMS client and the cert reloader.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/yahoo/k8s-athenz-syncer/pkg/version"
+)
+
+const namespace = "k8s_athenz_syncer"
+
+var (
+	// ZMSCallsTotal counts calls made to ZMS, by method and resulting HTTP status.
+	ZMSCallsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "zms_calls_total",
+		Help:      "Total number of ZMS API calls, by method and HTTP status.",
+	}, []string{"method", "status"})
+
+	// ZMSCallDuration tracks ZMS call latency by method.
+	ZMSCallDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "zms_call_duration_seconds",
+		Help:      "Latency of ZMS API calls in seconds, by method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method"})
+
+	// LastResyncTimestampSeconds records the unix time of the last successful full resync.
+	LastResyncTimestampSeconds = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_resync_timestamp_seconds",
+		Help:      "Unix timestamp of the last successful full resync.",
+	})
+
+	// CertReloadTotal counts cert reload attempts by result (success, error).
+	CertReloadTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cert_reload_total",
+		Help:      "Total number of key/cert reload attempts, by result.",
+	}, []string{"result"})
+
+	// ZMSRetriesTotal counts retry attempts the ZMS client made, by endpoint.
+	ZMSRetriesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "zms_retries_total",
+		Help:      "Total number of ZMS API call retries, by endpoint.",
+	}, []string{"endpoint"})
+
+	// ZMSCircuitBreakerOpen is 1 while the per-endpoint circuit breaker is
+	// open (or half-open) and 0 while it is closed.
+	ZMSCircuitBreakerOpen = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "zms_circuit_breaker_open",
+		Help:      "Whether the ZMS client circuit breaker is open for an endpoint (1) or closed (0).",
+	}, []string{"endpoint"})
+
+	// BuildInfo is a constant 1, labeled with the binary's build metadata,
+	// so it can be joined against other metrics in queries and dashboards.
+	BuildInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "build_info",
+		Help:      "Build metadata of the running binary. Always 1.",
+	}, []string{"version", "gitCommit", "buildDate", "goVersion"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		ZMSCallsTotal,
+		ZMSCallDuration,
+		LastResyncTimestampSeconds,
+		CertReloadTotal,
+		ZMSRetriesTotal,
+		ZMSCircuitBreakerOpen,
+		BuildInfo,
+	)
+
+	info := version.Get()
+	BuildInfo.WithLabelValues(info.Version, info.GitCommit, info.BuildDate, info.GoVersion).Set(1)
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2019, Oath Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// workqueueProvider adapts client-go's workqueue instrumentation hooks to
+// Prometheus collectors so workqueue depth, add rate, retries and latency
+// show up on /metrics alongside the rest of the syncer's metrics.
+type workqueueProvider struct{}
+
+var (
+	wqMu        sync.Mutex
+	gaugeVecs   = map[string]*prometheus.GaugeVec{}
+	counterVecs = map[string]*prometheus.CounterVec{}
+	histVecs    = map[string]*prometheus.HistogramVec{}
+)
+
+func gaugeVecFor(metricName, help string) *prometheus.GaugeVec {
+	wqMu.Lock()
+	defer wqMu.Unlock()
+	if v, ok := gaugeVecs[metricName]; ok {
+		return v
+	}
+	v := prometheus.NewGaugeVec(prometheus.GaugeOpts{Namespace: namespace, Name: metricName, Help: help}, []string{"name"})
+	prometheus.MustRegister(v)
+	gaugeVecs[metricName] = v
+	return v
+}
+
+func counterVecFor(metricName, help string) *prometheus.CounterVec {
+	wqMu.Lock()
+	defer wqMu.Unlock()
+	if v, ok := counterVecs[metricName]; ok {
+		return v
+	}
+	v := prometheus.NewCounterVec(prometheus.CounterOpts{Namespace: namespace, Name: metricName, Help: help}, []string{"name"})
+	prometheus.MustRegister(v)
+	counterVecs[metricName] = v
+	return v
+}
+
+func histVecFor(metricName, help string) *prometheus.HistogramVec {
+	wqMu.Lock()
+	defer wqMu.Unlock()
+	if v, ok := histVecs[metricName]; ok {
+		return v
+	}
+	v := prometheus.NewHistogramVec(prometheus.HistogramOpts{Namespace: namespace, Name: metricName, Help: help, Buckets: prometheus.DefBuckets}, []string{"name"})
+	prometheus.MustRegister(v)
+	histVecs[metricName] = v
+	return v
+}
+
+func (workqueueProvider) NewDepthMetric(name string) workqueue.GaugeMetric {
+	return gaugeVecFor("workqueue_depth", "Current depth of the workqueue.").WithLabelValues(name)
+}
+
+func (workqueueProvider) NewAddsMetric(name string) workqueue.CounterMetric {
+	return counterVecFor("workqueue_adds_total", "Total number of items added to the workqueue.").WithLabelValues(name)
+}
+
+func (workqueueProvider) NewLatencyMetric(name string) workqueue.HistogramMetric {
+	return histVecFor("workqueue_queue_duration_seconds", "How long an item stays in the workqueue before being processed.").WithLabelValues(name)
+}
+
+func (workqueueProvider) NewWorkDurationMetric(name string) workqueue.HistogramMetric {
+	return histVecFor("workqueue_work_duration_seconds", "How long it takes to process an item from the workqueue.").WithLabelValues(name)
+}
+
+func (workqueueProvider) NewRetriesMetric(name string) workqueue.CounterMetric {
+	return counterVecFor("workqueue_retries_total", "Total number of times an item was requeued for retry.").WithLabelValues(name)
+}
+
+func (workqueueProvider) NewUnfinishedWorkSecondsMetric(name string) workqueue.SettableGaugeMetric {
+	return gaugeVecFor("workqueue_unfinished_work_seconds", "How long in-flight items have been in progress.").WithLabelValues(name)
+}
+
+func (workqueueProvider) NewLongestRunningProcessorSecondsMetric(name string) workqueue.SettableGaugeMetric {
+	return gaugeVecFor("workqueue_longest_running_processor_seconds", "How long the longest running processor has been running.").WithLabelValues(name)
+}
+
+// RegisterWorkqueueProvider installs the Prometheus-backed workqueue
+// MetricsProvider. It should be called once, before any workqueue is
+// created.
+func RegisterWorkqueueProvider() {
+	workqueue.SetProvider(workqueueProvider{})
+}
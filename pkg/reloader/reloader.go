@@ -0,0 +1,117 @@
+/*
+Copyright 2019, Oath Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package reloader watches the Athenz service key/cert pair on disk and
+// keeps an in-memory tls.Certificate up to date so long running clients
+// never have to restart to pick up a renewed identity.
+package reloader
+
+import (
+	"context"
+	"crypto/tls"
+	"sync"
+	"time"
+
+	"github.com/yahoo/k8s-athenz-syncer/pkg/log"
+	"github.com/yahoo/k8s-athenz-syncer/pkg/metrics"
+)
+
+// pollInterval is how often the reloader checks the key/cert pair for
+// changes on disk.
+const pollInterval = 30 * time.Second
+
+// ReloadConfig holds the key/cert file locations to watch.
+type ReloadConfig struct {
+	KeyFile  string
+	CertFile string
+}
+
+// CertReloader keeps the latest valid key pair loaded from disk in memory.
+type CertReloader struct {
+	config ReloadConfig
+
+	lock        sync.RWMutex
+	cert        *tls.Certificate
+	lastSuccess time.Time
+}
+
+// NewCertReloader loads the initial key pair and starts a background
+// goroutine that polls for changes until ctx is done.
+func NewCertReloader(ctx context.Context, config ReloadConfig) (*CertReloader, error) {
+	r := &CertReloader{config: config}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	go r.watch(ctx)
+	return r, nil
+}
+
+// NewCertReloaderWithStopCh is a back-compat shim for callers that still
+// deal in the legacy stopCh channel instead of a context.Context.
+func NewCertReloaderWithStopCh(config ReloadConfig, stopCh <-chan struct{}) (*CertReloader, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-stopCh
+		cancel()
+	}()
+	return NewCertReloader(ctx, config)
+}
+
+func (r *CertReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(r.config.CertFile, r.config.KeyFile)
+	if err != nil {
+		metrics.CertReloadTotal.WithLabelValues("error").Inc()
+		return err
+	}
+	r.lock.Lock()
+	r.cert = &cert
+	r.lastSuccess = time.Now()
+	r.lock.Unlock()
+	metrics.CertReloadTotal.WithLabelValues("success").Inc()
+	return nil
+}
+
+func (r *CertReloader) watch(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := r.reload(); err != nil {
+				log.Errorf("Failed to reload cert/key pair. Error: %v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// GetLatestCertificate returns the most recently loaded certificate. It is
+// safe to call concurrently and is intended to be used as the
+// tls.Config.GetClientCertificate callback.
+func (r *CertReloader) GetLatestCertificate() *tls.Certificate {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.cert
+}
+
+// IsStale reports whether the reloader has gone longer than window without
+// successfully loading a valid key/cert pair.
+func (r *CertReloader) IsStale(window time.Duration) bool {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return time.Since(r.lastSuccess) > window
+}
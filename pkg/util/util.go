@@ -0,0 +1,44 @@
+/*
+Copyright 2019, Oath Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package util holds shared, process-wide configuration that the
+// controller consults while syncing namespaces and domains.
+package util
+
+// Util bundles the syncer-wide settings derived from command line flags.
+type Util struct {
+	AdminDomain      string
+	systemNamespaces map[string]bool
+}
+
+// NewUtil creates a Util from the admin domain and the list of namespaces
+// that should be skipped during sync (e.g. kube-system).
+func NewUtil(adminDomain string, systemNamespaces []string) *Util {
+	nsMap := make(map[string]bool, len(systemNamespaces))
+	for _, ns := range systemNamespaces {
+		nsMap[ns] = true
+	}
+	return &Util{
+		AdminDomain:      adminDomain,
+		systemNamespaces: nsMap,
+	}
+}
+
+// IsSystemNamespace returns true if ns was configured as a system namespace
+// and should be excluded from syncing.
+func (u *Util) IsSystemNamespace(ns string) bool {
+	return u.systemNamespaces[ns]
+}
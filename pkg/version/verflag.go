@@ -0,0 +1,45 @@
+/*
+Copyright 2019, Oath Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package version
+
+import (
+	"fmt"
+	"os"
+)
+
+// PrintAndExitIfRequested prints the binary's build metadata and exits the
+// process if showVersion is true. outputFormat selects the rendering:
+// "json" prints Info as indented JSON, anything else prints the
+// human-readable form.
+func PrintAndExitIfRequested(showVersion bool, outputFormat string) {
+	if !showVersion {
+		return
+	}
+
+	info := Get()
+	if outputFormat == "json" {
+		out, err := info.JSON()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error marshaling version info. Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(out)
+	} else {
+		fmt.Println(info.String())
+	}
+	os.Exit(0)
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2019, Oath Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package version carries build-time metadata about the syncer binary. The
+// variables below are populated at build time via linker flags, e.g.
+//
+//	go build -ldflags "-X github.com/yahoo/k8s-athenz-syncer/pkg/version.version=v1.2.3 \
+//	    -X github.com/yahoo/k8s-athenz-syncer/pkg/version.gitCommit=abcdef0 \
+//	    -X github.com/yahoo/k8s-athenz-syncer/pkg/version.buildDate=2019-09-01T00:00:00Z"
+//
+// and default to "unknown" when built without them, e.g. via `go run`.
+package version
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+)
+
+var (
+	version   = "unknown"
+	gitCommit = "unknown"
+	buildDate = "unknown"
+)
+
+// Info describes the build metadata of the running binary.
+type Info struct {
+	Version   string `json:"version"`
+	GitCommit string `json:"gitCommit"`
+	BuildDate string `json:"buildDate"`
+	GoVersion string `json:"goVersion"`
+}
+
+// Get returns the build metadata of the running binary.
+func Get() Info {
+	return Info{
+		Version:   version,
+		GitCommit: gitCommit,
+		BuildDate: buildDate,
+		GoVersion: runtime.Version(),
+	}
+}
+
+// String renders i in the human-readable form printed by --version.
+func (i Info) String() string {
+	return fmt.Sprintf("Version: %s\nGitCommit: %s\nBuildDate: %s\nGoVersion: %s", i.Version, i.GitCommit, i.BuildDate, i.GoVersion)
+}
+
+// JSON renders i as indented JSON, for --version -o json.
+func (i Info) JSON() (string, error) {
+	b, err := json.MarshalIndent(i, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
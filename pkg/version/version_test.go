@@ -0,0 +1,59 @@
+/*
+Copyright 2019, Oath Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package version
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestInfoString(t *testing.T) {
+	i := Info{Version: "v1.2.3", GitCommit: "abcdef0", BuildDate: "2019-09-01T00:00:00Z", GoVersion: "go1.21"}
+	s := i.String()
+	for _, want := range []string{"Version: v1.2.3", "GitCommit: abcdef0", "BuildDate: 2019-09-01T00:00:00Z", "GoVersion: go1.21"} {
+		if !strings.Contains(s, want) {
+			t.Errorf("String() = %q, want it to contain %q", s, want)
+		}
+	}
+}
+
+func TestInfoJSON(t *testing.T) {
+	i := Info{Version: "v1.2.3", GitCommit: "abcdef0", BuildDate: "2019-09-01T00:00:00Z", GoVersion: "go1.21"}
+	out, err := i.JSON()
+	if err != nil {
+		t.Fatalf("JSON() returned an error: %v", err)
+	}
+
+	var got Info
+	if err := json.Unmarshal([]byte(out), &got); err != nil {
+		t.Fatalf("JSON() did not produce valid JSON: %v", err)
+	}
+	if got != i {
+		t.Errorf("round-tripped JSON = %+v, want %+v", got, i)
+	}
+}
+
+func TestGetUsesDefaultsWhenUnset(t *testing.T) {
+	i := Get()
+	if i.Version != "unknown" || i.GitCommit != "unknown" || i.BuildDate != "unknown" {
+		t.Errorf("Get() = %+v, want the unset ldflags vars to default to \"unknown\"", i)
+	}
+	if i.GoVersion == "" {
+		t.Error("Get().GoVersion should never be empty")
+	}
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2019, Oath Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package zmsclient
+
+import (
+	"sync"
+	"time"
+
+	"github.com/yahoo/k8s-athenz-syncer/pkg/metrics"
+)
+
+// breakerState is the state of a single endpoint's circuit breaker.
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// breaker is a per-endpoint circuit breaker. It opens after threshold
+// consecutive failures, refuses calls until cooldown has elapsed, then
+// half-opens: calls are let through again, and the next recorded outcome
+// closes the breaker (success) or re-opens it (failure). Calls made while
+// half-open are not limited to a single one.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu        sync.Mutex
+	endpoints map[string]*endpointState
+}
+
+type endpointState struct {
+	state           breakerState
+	consecutiveFail int
+	openedAt        time.Time
+}
+
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	return &breaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		endpoints: make(map[string]*endpointState),
+	}
+}
+
+// allow reports whether a call to endpoint may proceed. It transitions a
+// breaker that has cooled down from open to half-open as a side effect.
+func (b *breaker) allow(endpoint string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	es := b.endpointState(endpoint)
+	switch es.state {
+	case breakerOpen:
+		if time.Since(es.openedAt) < b.cooldown {
+			return false
+		}
+		es.state = breakerHalfOpen
+		return true
+	default:
+		return true
+	}
+}
+
+// recordSuccess closes the breaker for endpoint and resets its failure count.
+func (b *breaker) recordSuccess(endpoint string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	es := b.endpointState(endpoint)
+	es.state = breakerClosed
+	es.consecutiveFail = 0
+	metrics.ZMSCircuitBreakerOpen.WithLabelValues(endpoint).Set(0)
+}
+
+// recordFailure records a failed call against endpoint, opening the breaker
+// once threshold consecutive failures have been seen.
+func (b *breaker) recordFailure(endpoint string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	es := b.endpointState(endpoint)
+	if es.state == breakerHalfOpen {
+		es.state = breakerOpen
+		es.openedAt = time.Now()
+		metrics.ZMSCircuitBreakerOpen.WithLabelValues(endpoint).Set(1)
+		return
+	}
+
+	es.consecutiveFail++
+	if es.consecutiveFail >= b.threshold {
+		es.state = breakerOpen
+		es.openedAt = time.Now()
+		metrics.ZMSCircuitBreakerOpen.WithLabelValues(endpoint).Set(1)
+	}
+}
+
+// endpointState returns the state for endpoint, creating it on first use.
+// Callers must hold b.mu.
+func (b *breaker) endpointState(endpoint string) *endpointState {
+	es, ok := b.endpoints[endpoint]
+	if !ok {
+		es = &endpointState{}
+		b.endpoints[endpoint] = es
+	}
+	return es
+}
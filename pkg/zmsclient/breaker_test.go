@@ -0,0 +1,91 @@
+/*
+Copyright 2019, Oath Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package zmsclient
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBreakerOpensAfterThreshold(t *testing.T) {
+	b := newBreaker(3, time.Minute)
+	const endpoint = "GET /zms/v1/domain"
+
+	for i := 0; i < 2; i++ {
+		b.recordFailure(endpoint)
+		if !b.allow(endpoint) {
+			t.Fatalf("breaker opened after %d failures, want threshold 3", i+1)
+		}
+	}
+	b.recordFailure(endpoint)
+	if b.allow(endpoint) {
+		t.Fatal("breaker should be open after 3 consecutive failures")
+	}
+}
+
+func TestBreakerHalfOpensAfterCooldown(t *testing.T) {
+	b := newBreaker(1, 10*time.Millisecond)
+	const endpoint = "GET /zms/v1/domain"
+
+	b.recordFailure(endpoint)
+	if b.allow(endpoint) {
+		t.Fatal("breaker should be open immediately after crossing threshold")
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if !b.allow(endpoint) {
+		t.Fatal("breaker should let a trial call through once cooled down")
+	}
+}
+
+func TestBreakerRecordSuccessClosesAndResets(t *testing.T) {
+	b := newBreaker(2, time.Minute)
+	const endpoint = "GET /zms/v1/domain"
+
+	b.recordFailure(endpoint)
+	b.recordSuccess(endpoint)
+	b.recordFailure(endpoint)
+	if !b.allow(endpoint) {
+		t.Fatal("a single failure after recordSuccess should not re-open the breaker")
+	}
+}
+
+func TestBreakerHalfOpenFailureReopens(t *testing.T) {
+	b := newBreaker(1, 10*time.Millisecond)
+	const endpoint = "GET /zms/v1/domain"
+
+	b.recordFailure(endpoint)
+	time.Sleep(20 * time.Millisecond)
+	if !b.allow(endpoint) {
+		t.Fatal("breaker should be half-open and allow a trial call")
+	}
+	b.recordFailure(endpoint)
+	if b.allow(endpoint) {
+		t.Fatal("a failed trial call should re-open the breaker")
+	}
+}
+
+func TestBreakerTracksEndpointsIndependently(t *testing.T) {
+	b := newBreaker(1, time.Minute)
+	b.recordFailure("GET /zms/v1/domain/a")
+	if b.allow("GET /zms/v1/domain/a") {
+		t.Fatal("endpoint a should be open")
+	}
+	if !b.allow("GET /zms/v1/domain/b") {
+		t.Fatal("endpoint b should be unaffected by endpoint a's failures")
+	}
+}
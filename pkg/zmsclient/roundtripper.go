@@ -0,0 +1,265 @@
+/*
+Copyright 2019, Oath Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package zmsclient wraps the transport used to talk to ZMS with retries,
+// exponential backoff and a per-endpoint circuit breaker, so that transient
+// ZMS outages don't surface as sync failures in the controller.
+package zmsclient
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yahoo/k8s-athenz-syncer/pkg/log"
+	"github.com/yahoo/k8s-athenz-syncer/pkg/metrics"
+)
+
+// Config controls the retry and circuit-breaker behavior of a Transport.
+type Config struct {
+	// MaxRetries is the number of retry attempts after the initial call.
+	MaxRetries int
+	// RetryBaseDelay is the base delay used for exponential backoff between
+	// retries; each attempt waits RetryBaseDelay*2^n plus jitter.
+	RetryBaseDelay time.Duration
+	// BreakerThreshold is the number of consecutive failures against an
+	// endpoint that opens its circuit breaker.
+	BreakerThreshold int
+	// BreakerCooldown is how long an open breaker stays open before it
+	// half-opens and lets calls through again.
+	BreakerCooldown time.Duration
+	// CallDeadline bounds the total time (including all retries) spent on a
+	// single call. Zero means no deadline beyond req.Context().
+	CallDeadline time.Duration
+}
+
+// Transport wraps another http.RoundTripper, retrying retryable failures
+// with exponential backoff and short-circuiting calls to endpoints that are
+// failing consistently.
+type Transport struct {
+	next    http.RoundTripper
+	cfg     Config
+	breaker *breaker
+}
+
+// NewTransport wraps next with retry and circuit-breaker behavior per cfg.
+func NewTransport(next http.RoundTripper, cfg Config) *Transport {
+	return &Transport{
+		next:    next,
+		cfg:     cfg,
+		breaker: newBreaker(cfg.BreakerThreshold, cfg.BreakerCooldown),
+	}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	endpoint := req.Method + " " + routeTemplate(req.URL.Path)
+
+	if !t.breaker.allow(endpoint) {
+		metrics.ZMSCallsTotal.WithLabelValues(req.Method, "circuit_open").Inc()
+		return nil, &CircuitOpenError{Endpoint: endpoint}
+	}
+
+	// cancel runs on the error paths below; on success it runs when the
+	// caller closes the response body, so the body stays readable.
+	cancel := context.CancelFunc(func() {})
+	if t.cfg.CallDeadline > 0 {
+		var ctx context.Context
+		ctx, cancel = context.WithTimeout(req.Context(), t.cfg.CallDeadline)
+		req = req.WithContext(ctx)
+	}
+
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+	}
+
+	start := time.Now()
+	var resp *http.Response
+	var err error
+
+	for attempt := 0; attempt <= t.cfg.MaxRetries; attempt++ {
+		if attempt > 0 {
+			metrics.ZMSRetriesTotal.WithLabelValues(endpoint).Inc()
+		}
+		if body != nil {
+			req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		}
+
+		resp, err = t.next.RoundTrip(req)
+		if !retryable(resp, err) {
+			break
+		}
+
+		if attempt == t.cfg.MaxRetries {
+			break
+		}
+
+		delay := backoffDelay(t.cfg.RetryBaseDelay, attempt)
+		if resp != nil {
+			if ra, ok := retryAfter(resp); ok {
+				delay = ra
+			}
+			resp.Body.Close()
+		}
+
+		select {
+		case <-req.Context().Done():
+			if err == nil {
+				err = req.Context().Err()
+			}
+			attempt = t.cfg.MaxRetries
+		case <-time.After(delay):
+		}
+		log.Warnf("Retrying ZMS call to %s after error (attempt %d/%d)", endpoint, attempt+1, t.cfg.MaxRetries)
+	}
+
+	metrics.ZMSCallDuration.WithLabelValues(req.Method).Observe(time.Since(start).Seconds())
+
+	if err != nil {
+		cancel()
+		t.breaker.recordFailure(endpoint)
+		metrics.ZMSCallsTotal.WithLabelValues(req.Method, "error").Inc()
+		return nil, err
+	}
+	resp.Body = &cancelOnCloseBody{ReadCloser: resp.Body, cancel: cancel}
+
+	status := strconv.Itoa(resp.StatusCode)
+	metrics.ZMSCallsTotal.WithLabelValues(req.Method, status).Inc()
+	if isRetryableStatus(resp.StatusCode) {
+		t.breaker.recordFailure(endpoint)
+	} else {
+		t.breaker.recordSuccess(endpoint)
+	}
+	return resp, nil
+}
+
+// cancelOnCloseBody releases a call's deadline context once the caller
+// closes the response body.
+type cancelOnCloseBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnCloseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// CircuitOpenError is returned when a call is refused because the
+// endpoint's circuit breaker is open.
+type CircuitOpenError struct {
+	Endpoint string
+}
+
+func (e *CircuitOpenError) Error() string {
+	return "zmsclient: circuit breaker open for " + e.Endpoint
+}
+
+// zmsPathParamKeywords are ZMS resource-collection path segments that are
+// always immediately followed by a variable identifier (a domain, role,
+// policy, etc. name) in the URL.
+var zmsPathParamKeywords = map[string]bool{
+	"domain":    true,
+	"role":      true,
+	"policy":    true,
+	"service":   true,
+	"group":     true,
+	"entity":    true,
+	"template":  true,
+	"principal": true,
+	"resource":  true,
+	"assertion": true,
+	"member":    true,
+	"tenancy":   true,
+	"provider":  true,
+}
+
+// routeTemplate collapses path to a bounded-cardinality route by replacing
+// the identifier that follows a known ZMS resource-collection segment with
+// a fixed placeholder, e.g. "/zms/v1/domain/some-team/role/admins" becomes
+// "/zms/v1/domain/{}/role/{}". Without this, breaker.endpoints (and the
+// metrics keyed by endpoint) would grow one entry per distinct domain ever
+// synced instead of aggregating failures the way a per-route circuit
+// breaker is meant to.
+func routeTemplate(path string) string {
+	segments := strings.Split(path, "/")
+	for i := 0; i < len(segments)-1; i++ {
+		if zmsPathParamKeywords[segments[i]] && segments[i+1] != "" {
+			segments[i+1] = "{}"
+			i++
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return isRetryableStatus(resp.StatusCode)
+}
+
+func isRetryableStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// retryAfter parses the Retry-After header on a 429/503 response, returning
+// its delay and true if present and valid.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		return 0, false
+	}
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d, true
+		}
+	}
+	return 0, false
+}
+
+// backoffDelay returns the exponential backoff delay for the given attempt
+// (0-indexed), with up to 20% jitter added to avoid retry storms.
+func backoffDelay(base time.Duration, attempt int) time.Duration {
+	d := base << uint(attempt)
+	jitter := time.Duration(rand.Int63n(int64(d)/5 + 1))
+	return d + jitter
+}
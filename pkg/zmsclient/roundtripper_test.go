@@ -0,0 +1,226 @@
+/*
+Copyright 2019, Oath Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package zmsclient
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIsRetryableStatus(t *testing.T) {
+	cases := map[int]bool{
+		http.StatusOK:                  false,
+		http.StatusNotFound:            false,
+		http.StatusInternalServerError: false,
+		http.StatusTooManyRequests:     true,
+		http.StatusBadGateway:          true,
+		http.StatusServiceUnavailable:  true,
+		http.StatusGatewayTimeout:      true,
+	}
+	for status, want := range cases {
+		if got := isRetryableStatus(status); got != want {
+			t.Errorf("isRetryableStatus(%d) = %v, want %v", status, got, want)
+		}
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	if !retryable(nil, errors.New("network blip")) {
+		t.Error("retryable(nil, err) = false, want true")
+	}
+	if retryable(&http.Response{StatusCode: http.StatusOK}, nil) {
+		t.Error("retryable(200, nil) = true, want false")
+	}
+	if !retryable(&http.Response{StatusCode: http.StatusServiceUnavailable}, nil) {
+		t.Error("retryable(503, nil) = false, want true")
+	}
+}
+
+func TestRetryAfterSeconds(t *testing.T) {
+	resp := &http.Response{
+		StatusCode: http.StatusTooManyRequests,
+		Header:     http.Header{"Retry-After": []string{"5"}},
+	}
+	d, ok := retryAfter(resp)
+	if !ok || d != 5*time.Second {
+		t.Errorf("retryAfter() = %v, %v; want 5s, true", d, ok)
+	}
+}
+
+func TestRetryAfterIgnoredForNonRetryableStatus(t *testing.T) {
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Retry-After": []string{"5"}},
+	}
+	if _, ok := retryAfter(resp); ok {
+		t.Error("retryAfter() on a 200 should be ignored")
+	}
+}
+
+func TestRetryAfterMissingHeader(t *testing.T) {
+	resp := &http.Response{StatusCode: http.StatusServiceUnavailable, Header: http.Header{}}
+	if _, ok := retryAfter(resp); ok {
+		t.Error("retryAfter() with no header should report ok=false")
+	}
+}
+
+func TestRouteTemplate(t *testing.T) {
+	cases := map[string]string{
+		"/zms/v1/domain/my-team/role/admins":     "/zms/v1/domain/{}/role/{}",
+		"/zms/v1/domain":                         "/zms/v1/domain",
+		"/zms/v1/domain/":                        "/zms/v1/domain/",
+		"/zms/v1/domain/my-team.sub/service/api": "/zms/v1/domain/{}/service/{}",
+		"/zms/v1/status":                         "/zms/v1/status",
+	}
+	for path, want := range cases {
+		if got := routeTemplate(path); got != want {
+			t.Errorf("routeTemplate(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestRoundTripRetriesThenSucceeds(t *testing.T) {
+	var calls int32
+	var bodies []string
+	var mu sync.Mutex
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(b))
+		mu.Unlock()
+
+		if atomic.AddInt32(&calls, 1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	transport := NewTransport(http.DefaultTransport, Config{
+		MaxRetries:     2,
+		RetryBaseDelay: time.Millisecond,
+	})
+
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/zms/v1/domain/my-team/role/admins", strings.NewReader("payload"))
+	if err != nil {
+		t.Fatalf("NewRequest() error = %v", err)
+	}
+
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip() error = %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("RoundTrip() status = %d, want 200", resp.StatusCode)
+	}
+	if got := atomic.LoadInt32(&calls); got != 3 {
+		t.Errorf("server saw %d calls, want 3 (2 failures + 1 success)", got)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for i, b := range bodies {
+		if b != "payload" {
+			t.Errorf("attempt %d body = %q, want %q (body must be re-readable across retries)", i, b, "payload")
+		}
+	}
+}
+
+func TestRoundTripOpensBreakerAfterRepeatedFailures(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	transport := NewTransport(http.DefaultTransport, Config{
+		MaxRetries:       0,
+		RetryBaseDelay:   time.Millisecond,
+		BreakerThreshold: 1,
+		BreakerCooldown:  time.Minute,
+	})
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/zms/v1/domain/my-team", nil)
+	if err != nil {
+		t.Fatalf("NewRequest() error = %v", err)
+	}
+
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip() error = %v", err)
+	}
+	resp.Body.Close()
+
+	req2, err := http.NewRequest(http.MethodGet, srv.URL+"/zms/v1/domain/another-team", nil)
+	if err != nil {
+		t.Fatalf("NewRequest() error = %v", err)
+	}
+	_, err = transport.RoundTrip(req2)
+	if _, ok := err.(*CircuitOpenError); !ok {
+		t.Fatalf("RoundTrip() error = %v, want *CircuitOpenError (breaker should key on the templated route, not the raw path)", err)
+	}
+}
+
+func TestRoundTripRespectsCallDeadline(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// srv.Close (deferred after close(block)) waits for this handler, so
+		// it also returns once the client has given up on the request.
+		select {
+		case <-block:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+
+	transport := NewTransport(http.DefaultTransport, Config{
+		CallDeadline: 20 * time.Millisecond,
+	})
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/zms/v1/status", nil)
+	if err != nil {
+		t.Fatalf("NewRequest() error = %v", err)
+	}
+
+	_, err = transport.RoundTrip(req)
+	if err == nil {
+		t.Fatal("RoundTrip() error = nil, want a deadline-exceeded error")
+	}
+}
+
+func TestBackoffDelayGrowsExponentially(t *testing.T) {
+	base := 100 * time.Millisecond
+	for attempt := 0; attempt < 4; attempt++ {
+		d := backoffDelay(base, attempt)
+		min := base << uint(attempt)
+		max := min + min/5 + 1
+		if d < min || d > max {
+			t.Errorf("backoffDelay(%s, %d) = %s, want in [%s, %s]", base, attempt, d, min, max)
+		}
+	}
+}